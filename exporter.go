@@ -2,6 +2,7 @@ package esexporter
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/buger/jsonparser"
@@ -15,7 +16,46 @@ var (
 	ErrUserCancelled = errors.New("user cancelled")
 )
 
-type SourceHandler func(buf []byte, id int64, total int64) error
+// Progress describes a single document delivered to a SourceHandler: Cursor is its
+// zero-based position in the export, and Total comes from its batch's response, parsed from
+// hits.total whether the cluster reports it as a bare integer (<ES7) or as an object
+// (ES7+, {"value": N, "relation": "eq|gte"}); TotalRelation carries that relation along,
+// "eq" when the cluster reports a bare integer.
+type Progress struct {
+	Cursor        int64
+	Total         int64
+	TotalRelation string
+}
+
+type SourceHandler func(buf []byte, prg Progress) error
+
+// Hit carries a document's full hit metadata, delivered to a HitHandler instead of a raw
+// _source byte slice when Options.IncludeMetadata is set, so reindexers and other
+// downstream consumers can preserve the original _id/_routing on write.
+type Hit struct {
+	Index   string
+	Type    string
+	ID      string
+	Routing string
+	Score   float64
+	Sort    []interface{}
+	Source  []byte
+}
+
+// HitHandler is the Options.IncludeMetadata variant of SourceHandler, see NewWithHits.
+type HitHandler func(hit Hit, prg Progress) error
+
+// Mode selects the cursor strategy used to paginate through an index. The zero value
+// auto-detects the cluster version in Do and picks ModeSearchAfter when PIT is available
+// (ES 7.10+), falling back to ModeScroll otherwise.
+type Mode string
+
+const (
+	// ModeScroll uses the classic scroll API, see exporter.do
+	ModeScroll Mode = "scroll"
+	// ModeSearchAfter uses a Point-In-Time plus search_after, see searchafter.go
+	ModeSearchAfter Mode = "search_after"
+)
 
 type Options struct {
 	Index         string
@@ -24,20 +64,52 @@ type Options struct {
 	Scroll        string
 	BatchByteSize int64
 	NoMappingType bool
+
+	// Mode selects between ModeScroll and ModeSearchAfter, auto-detected when unset
+	Mode Mode
+	// Sort is the tiebreakable sort used by ModeSearchAfter, defaults to [{_shard_doc: asc}]
+	Sort []elastic.Sorter
+	// PITKeepAlive is the keep_alive passed when opening and refreshing the PIT, defaults to "1m"
+	PITKeepAlive string
+	// CheckpointPath, if set, persists resumption state for ModeSearchAfter to a file
+	CheckpointPath string
+	// Checkpoint, if set and CheckpointPath is empty, persists resumption state to an
+	// arbitrary sink. It must additionally implement io.Seeker and Truncate(int64) error
+	// (as *os.File does) so each checkpoint overwrites the last instead of being appended
+	// after it; Do returns an error otherwise.
+	Checkpoint io.ReadWriter
+
+	// Slices, if > 1, fans the scroll out over that many concurrent sliced-scroll workers
+	Slices int
+
+	// SourceIncludes and SourceExcludes project _source down to the listed fields, see
+	// https://www.elastic.co/guide/en/elasticsearch/reference/current/search-fields.html#source-filtering
+	SourceIncludes []string
+	SourceExcludes []string
+	// IncludeMetadata, if set, delivers a Hit to a HitHandler (see NewWithHits) instead of
+	// a raw _source byte slice to a SourceHandler
+	IncludeMetadata bool
 }
 
 type Exporter interface {
 	Do(ctx context.Context) error
+	// TotalDocs reports the current document count of Options.Index via the _stats endpoint
+	TotalDocs(ctx context.Context) (int64, error)
 }
 
 type exporter struct {
 	Options
 
-	client  *elastic.Client
-	handler SourceHandler
+	client            *elastic.Client
+	handler           SourceHandler
+	hitHandler        HitHandler
+	concurrentHandler ConcurrentSourceHandler
 
 	scrollID string
 
+	pitID    string
+	lastSort []interface{}
+
 	size   int64
 	cursor int64
 }
@@ -67,24 +139,57 @@ func (e *exporter) buildSearchPath() string {
 	}
 }
 
-func (e *exporter) buildSearchBody(size interface{}) (b map[string]interface{}, err error) {
+func (e *exporter) buildSearchBody(size interface{}, sort interface{}) (b map[string]interface{}, err error) {
 	b = map[string]interface{}{
 		"size": size,
-		// optimization, see https://www.elastic.co/guide/en/elasticsearch/reference/6.3/search-request-scroll.html
-		"sort": []string{"_doc"},
+		"sort": sort,
 	}
 	if e.Query != nil {
 		if b["query"], err = e.Query.Source(); err != nil {
 			return
 		}
 	}
+	if len(e.SourceIncludes) > 0 || len(e.SourceExcludes) > 0 {
+		src := map[string]interface{}{}
+		if len(e.SourceIncludes) > 0 {
+			src["includes"] = e.SourceIncludes
+		}
+		if len(e.SourceExcludes) > 0 {
+			src["excludes"] = e.SourceExcludes
+		}
+		b["_source"] = src
+	}
+	return
+}
+
+// parseHit parses one hits.hits[i] entry into a Hit, used when Options.IncludeMetadata is
+// set. Type, ID, Routing, Score and Sort are optional depending on the query and cluster
+// version, so only a missing/non-object _source is treated as an error.
+func parseHit(value []byte) (hit Hit, err error) {
+	hit.Index, _ = jsonparser.GetString(value, "_index")
+	hit.Type, _ = jsonparser.GetString(value, "_type")
+	hit.ID, _ = jsonparser.GetString(value, "_id")
+	hit.Routing, _ = jsonparser.GetString(value, "_routing")
+	hit.Score, _ = jsonparser.GetFloat(value, "_score")
+	if sortBuf, _, _, serr := jsonparser.Get(value, "sort"); serr == nil {
+		_ = json.Unmarshal(sortBuf, &hit.Sort)
+	}
+
+	var srcType jsonparser.ValueType
+	if hit.Source, srcType, _, err = jsonparser.Get(value, "_source"); err != nil {
+		return
+	}
+	if srcType != jsonparser.Object {
+		err = errors.New("missing _source in hits.hits")
+	}
 	return
 }
 
 func (e *exporter) estimateBatchSize(ctx context.Context) (err error) {
 	const Sample = 512
 	var body interface{}
-	if body, err = e.buildSearchBody(Sample); err != nil {
+	// optimization, see https://www.elastic.co/guide/en/elasticsearch/reference/6.3/search-request-scroll.html
+	if body, err = e.buildSearchBody(Sample, []string{"_doc"}); err != nil {
 		return
 	}
 	var res *elastic.Response
@@ -116,7 +221,7 @@ func (e *exporter) do(ctx context.Context) (err error) {
 	var res *elastic.Response
 	if e.scrollID == "" {
 		var body interface{}
-		if body, err = e.buildSearchBody(e.size); err != nil {
+		if body, err = e.buildSearchBody(e.size, []string{"_doc"}); err != nil {
 			return
 		}
 		if res, err = e.client.PerformRequest(ctx, elastic.PerformRequestOptions{
@@ -164,7 +269,8 @@ func (e *exporter) do(ctx context.Context) (err error) {
 
 	// check total
 	var total int64
-	if total, err = jsonparser.GetInt(buf, "hits", "total"); err != nil {
+	var totalRelation string
+	if total, totalRelation, err = parseHitsTotal(buf); err != nil {
 		return
 	}
 
@@ -191,16 +297,28 @@ func (e *exporter) do(ctx context.Context) (err error) {
 			itErr = docErr
 			return
 		}
-		srcBuf, srcType, _, srcErr := jsonparser.Get(value, "_source")
-		if srcErr != nil {
-			itErr = srcErr
-			return
-		}
-		if srcType != jsonparser.Object {
-			itErr = errors.New("missing _source in hits.hits")
-			return
+		prg := Progress{Cursor: e.cursor, Total: total, TotalRelation: totalRelation}
+		if e.IncludeMetadata {
+			var hit Hit
+			if hit, itErr = parseHit(value); itErr != nil {
+				return
+			}
+			itErr = e.hitHandler(hit, prg)
+		} else {
+			var srcBuf []byte
+			var srcType jsonparser.ValueType
+			var srcErr error
+			if srcBuf, srcType, _, srcErr = jsonparser.Get(value, "_source"); srcErr != nil {
+				itErr = srcErr
+				return
+			}
+			if srcType != jsonparser.Object {
+				itErr = errors.New("missing _source in hits.hits")
+				return
+			}
+			itErr = e.handler(srcBuf, prg)
 		}
-		if itErr = e.handler(srcBuf, e.cursor, total); itErr != nil {
+		if itErr != nil {
 			return
 		}
 		e.cursor = e.cursor + 1
@@ -219,7 +337,76 @@ func (e *exporter) do(ctx context.Context) (err error) {
 	return
 }
 
+// parseHitsTotal parses hits.total whether it is a bare integer (<ES7) or an object
+// (ES7+, {"value": N, "relation": "eq|gte"}), returning "eq" as the relation in the
+// bare-integer case since that form is always exact.
+func parseHitsTotal(buf []byte) (total int64, relation string, err error) {
+	if total, err = jsonparser.GetInt(buf, "hits", "total"); err == nil {
+		relation = "eq"
+		return
+	}
+	if total, err = jsonparser.GetInt(buf, "hits", "total", "value"); err != nil {
+		return
+	}
+	if relation, err = jsonparser.GetString(buf, "hits", "total", "relation"); err != nil {
+		relation = "eq"
+		err = nil
+	}
+	return
+}
+
+// detectCluster reports the cluster's major/minor version via GET / so Do can choose
+// NoMappingType and Mode without the caller hand-configuring them per cluster version.
+func (e *exporter) detectCluster(ctx context.Context) (major, minor int, err error) {
+	var res *elastic.Response
+	if res, err = e.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodGet,
+		Path:   "/",
+	}); err != nil {
+		return
+	}
+	var versionStr string
+	if versionStr, err = jsonparser.GetString(res.Body, "version", "number"); err != nil {
+		return
+	}
+	if _, err = fmt.Sscanf(versionStr, "%d.%d.", &major, &minor); err != nil {
+		return
+	}
+	return
+}
+
 func (e *exporter) Do(ctx context.Context) (err error) {
+	if e.Mode == "" {
+		var major, minor int
+		if major, minor, err = e.detectCluster(ctx); err != nil {
+			return
+		}
+		if major >= 7 {
+			e.NoMappingType = true
+		}
+		if major > 7 || (major == 7 && minor >= 10) {
+			e.Mode = ModeSearchAfter
+		} else {
+			e.Mode = ModeScroll
+		}
+	}
+	if e.Slices > 1 {
+		if e.IncludeMetadata {
+			// doSlice/ConcurrentSourceHandler only ever extract raw _source today; refuse
+			// rather than silently discarding every document by calling a Hit-less
+			// e.handler no-op underneath NewWithHits.
+			return errors.New("esexporter: Options.IncludeMetadata is not supported together with Options.Slices > 1")
+		}
+		ch := e.concurrentHandler
+		if ch == nil {
+			h := e.handler
+			ch = func(buf []byte, slice int, prg Progress) error { return h(buf, prg) }
+		}
+		return e.doSlices(ctx, ch)
+	}
+	if e.Mode == ModeSearchAfter {
+		return e.doResumable(ctx)
+	}
 	defer e.deleteScrollID()
 	if err = e.estimateBatchSize(ctx); err != nil {
 		return
@@ -234,6 +421,19 @@ func (e *exporter) Do(ctx context.Context) (err error) {
 	}
 }
 
+// TotalDocs returns the current document count of Options.Index, analogous to getDocsCount
+// in the external fetcher, so callers can render progress before Do reports a total.
+func (e *exporter) TotalDocs(ctx context.Context) (total int64, err error) {
+	var res *elastic.Response
+	if res, err = e.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodGet,
+		Path:   "/" + e.Index + "/_stats/docs",
+	}); err != nil {
+		return
+	}
+	return jsonparser.GetInt(res.Body, "_all", "primaries", "docs", "count")
+}
+
 func New(client *elastic.Client, opts Options, handler SourceHandler) Exporter {
 	if opts.Type == "" {
 		opts.Type = "_doc"
@@ -244,8 +444,11 @@ func New(client *elastic.Client, opts Options, handler SourceHandler) Exporter {
 	if opts.BatchByteSize <= 0 {
 		opts.BatchByteSize = 10 * 1024 * 1024
 	}
+	if opts.PITKeepAlive == "" {
+		opts.PITKeepAlive = "1m"
+	}
 	if handler == nil {
-		handler = func(buf []byte, idx int64, total int64) error { return nil }
+		handler = func(buf []byte, prg Progress) error { return nil }
 	}
 	return &exporter{
 		Options: opts,
@@ -253,3 +456,12 @@ func New(client *elastic.Client, opts Options, handler SourceHandler) Exporter {
 		handler: handler,
 	}
 }
+
+// NewWithHits is like New, but accepts a HitHandler and forces Options.IncludeMetadata so
+// each delivered Hit carries its _index/_type/_id/_routing/_score/_sort alongside _source.
+func NewWithHits(client *elastic.Client, opts Options, handler HitHandler) Exporter {
+	opts.IncludeMetadata = true
+	e := New(client, opts, nil).(*exporter)
+	e.hitHandler = handler
+	return e
+}
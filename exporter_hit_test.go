@@ -0,0 +1,65 @@
+package esexporter
+
+import (
+	"context"
+	"github.com/olivere/elastic"
+	"testing"
+)
+
+func TestParseHit(t *testing.T) {
+	body := []byte(`{
+		"_index": "idx",
+		"_type": "_doc",
+		"_id": "abc123",
+		"_routing": "shard-key",
+		"_score": 1.5,
+		"sort": [1627, "tiebreak"],
+		"_source": {"a": 1}
+	}`)
+
+	hit, err := parseHit(body)
+	if err != nil {
+		t.Fatalf("parseHit: %v", err)
+	}
+	if hit.Index != "idx" || hit.Type != "_doc" || hit.ID != "abc123" || hit.Routing != "shard-key" {
+		t.Fatalf("got %+v", hit)
+	}
+	if hit.Score != 1.5 {
+		t.Fatalf("got Score=%v, want 1.5", hit.Score)
+	}
+	if len(hit.Sort) != 2 {
+		t.Fatalf("got Sort=%v, want 2 elements", hit.Sort)
+	}
+	if string(hit.Source) != `{"a": 1}` {
+		t.Fatalf("got Source=%s", hit.Source)
+	}
+}
+
+func TestParseHit_MissingSourceErrors(t *testing.T) {
+	if _, err := parseHit([]byte(`{"_index":"idx","_id":"1"}`)); err == nil {
+		t.Fatal("expected an error when _source is missing")
+	}
+}
+
+func TestParseHit_OptionalFieldsMissing(t *testing.T) {
+	hit, err := parseHit([]byte(`{"_source":{}}`))
+	if err != nil {
+		t.Fatalf("parseHit: %v", err)
+	}
+	if hit.Index != "" || hit.Type != "" || hit.ID != "" || hit.Routing != "" || hit.Score != 0 || hit.Sort != nil {
+		t.Fatalf("expected zero-value optional fields, got %+v", hit)
+	}
+}
+
+func TestDo_RejectsSlicesWithIncludeMetadata(t *testing.T) {
+	client, err := elastic.NewClient(elastic.SetURL("http://127.0.0.1:0"), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatalf("elastic.NewClient: %v", err)
+	}
+
+	// an explicit Mode skips the GET / version probe, so the error can only be the rejection
+	e := NewWithHits(client, Options{Index: "idx", Slices: 2, Mode: ModeScroll}, func(hit Hit, prg Progress) error { return nil })
+	if err := e.Do(context.Background()); err == nil {
+		t.Fatal("expected Do to reject Options.Slices > 1 combined with Options.IncludeMetadata")
+	}
+}
@@ -0,0 +1,61 @@
+package esexporter
+
+import "testing"
+
+func TestParseHitsTotal(t *testing.T) {
+	cases := []struct {
+		name         string
+		body         string
+		wantTotal    int64
+		wantRelation string
+		wantErr      bool
+	}{
+		{
+			name:         "bare integer (<ES7)",
+			body:         `{"hits":{"total":42}}`,
+			wantTotal:    42,
+			wantRelation: "eq",
+		},
+		{
+			name:         "object form, eq",
+			body:         `{"hits":{"total":{"value":42,"relation":"eq"}}}`,
+			wantTotal:    42,
+			wantRelation: "eq",
+		},
+		{
+			name:         "object form, gte",
+			body:         `{"hits":{"total":{"value":10000,"relation":"gte"}}}`,
+			wantTotal:    10000,
+			wantRelation: "gte",
+		},
+		{
+			name:         "object form, missing relation defaults to eq",
+			body:         `{"hits":{"total":{"value":7}}}`,
+			wantTotal:    7,
+			wantRelation: "eq",
+		},
+		{
+			name:    "missing total",
+			body:    `{"hits":{}}`,
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			total, relation, err := parseHitsTotal([]byte(c.body))
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got total=%d relation=%q", total, relation)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseHitsTotal: %v", err)
+			}
+			if total != c.wantTotal || relation != c.wantRelation {
+				t.Fatalf("got total=%d relation=%q, want total=%d relation=%q", total, relation, c.wantTotal, c.wantRelation)
+			}
+		})
+	}
+}
@@ -17,15 +17,15 @@ func TestExporter_Do(t *testing.T) {
 
 	prg := logutil.NewProgress(logutil.LoggerFunc(log.Printf), "test")
 
-	handler := SourceHandler(func(buf []byte, id int64, total int64) error {
-		if max > 0 && id >= max {
+	handler := SourceHandler(func(buf []byte, p Progress) error {
+		if max > 0 && p.Cursor >= max {
 			return ErrUserCancelled
 		}
 		log.Printf("%s", buf)
-		prg.SetTotal(total)
-		prg.SetCount(id)
-		maxId = id
-		totalCount = total
+		prg.SetTotal(p.Total)
+		prg.SetCount(p.Cursor)
+		maxId = p.Cursor
+		totalCount = p.Total
 		totalSize += int64(len(buf))
 		return nil
 	})
@@ -0,0 +1,358 @@
+package esexporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/olivere/elastic"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// checkpoint is the resumption state persisted between Do invocations in ModeSearchAfter.
+type checkpoint struct {
+	PITID    string        `json:"pit_id"`
+	LastSort []interface{} `json:"last_sort"`
+	Cursor   int64         `json:"cursor"`
+}
+
+func (e *exporter) loadCheckpoint() (cp checkpoint, ok bool, err error) {
+	var buf []byte
+	if e.CheckpointPath != "" {
+		if buf, err = os.ReadFile(e.CheckpointPath); err != nil {
+			if os.IsNotExist(err) {
+				err = nil
+			}
+			return
+		}
+	} else if e.Checkpoint != nil {
+		if buf, err = io.ReadAll(e.Checkpoint); err != nil {
+			return
+		}
+	}
+	if len(buf) == 0 {
+		return
+	}
+	if err = json.Unmarshal(buf, &cp); err != nil {
+		return
+	}
+	ok = true
+	return
+}
+
+// checkpointSink is what Options.Checkpoint must implement for saveCheckpoint to overwrite
+// the previous checkpoint in place; a plain io.ReadWriter (e.g. *bytes.Buffer) cannot be
+// rewound or truncated, so every save would just append another JSON blob after the last
+// one, corrupting the file for the next loadCheckpoint. *os.File satisfies this.
+type checkpointSink interface {
+	io.ReadWriter
+	io.Seeker
+	Truncate(size int64) error
+}
+
+func (e *exporter) saveCheckpoint(cp checkpoint) (err error) {
+	var buf []byte
+	if buf, err = json.Marshal(cp); err != nil {
+		return
+	}
+	if e.CheckpointPath != "" {
+		return os.WriteFile(e.CheckpointPath, buf, 0644)
+	}
+	if e.Checkpoint != nil {
+		sink, ok := e.Checkpoint.(checkpointSink)
+		if !ok {
+			return errors.New("esexporter: Options.Checkpoint must implement io.Seeker and Truncate(int64) error to be safely overwritten; use CheckpointPath or a *os.File")
+		}
+		if err = sink.Truncate(0); err != nil {
+			return
+		}
+		if _, err = sink.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		_, err = sink.Write(buf)
+	}
+	return
+}
+
+// clearCheckpoint removes the persisted checkpoint once an export reaches a clean EOF, so a
+// subsequent intentional re-run starts a fresh full export instead of silently resuming from
+// the tail position of the finished one and exporting zero documents.
+func (e *exporter) clearCheckpoint() (err error) {
+	if e.CheckpointPath != "" {
+		if err = os.Remove(e.CheckpointPath); err != nil && os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if e.Checkpoint != nil {
+		if sink, ok := e.Checkpoint.(checkpointSink); ok {
+			if err = sink.Truncate(0); err != nil {
+				return
+			}
+			_, err = sink.Seek(0, io.SeekStart)
+		}
+	}
+	return
+}
+
+func (e *exporter) openPIT(ctx context.Context) (pitID string, err error) {
+	var res *elastic.Response
+	if res, err = e.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   "/" + e.Index + "/_pit",
+		Params: url.Values{"keep_alive": []string{e.PITKeepAlive}},
+	}); err != nil {
+		return
+	}
+	return jsonparser.GetString(res.Body, "id")
+}
+
+// pitExpiredError marks an ES response that looks like a rejected/expired PIT id, so
+// doResumable can tell it apart from any other search failure and recover by opening a
+// fresh PIT instead of aborting the whole resume.
+type pitExpiredError struct {
+	cause error
+}
+
+func (e *pitExpiredError) Error() string {
+	return fmt.Sprintf("pit expired or not found: %v", e.cause)
+}
+
+func (e *pitExpiredError) Unwrap() error {
+	return e.cause
+}
+
+// isPITExpiredErr reports whether err (as returned by elastic.Client.PerformRequest) looks
+// like a rejected/expired PIT id rather than any other kind of search failure. PerformRequest
+// turns any non-2xx response into a non-nil *elastic.Error, so the status/reason must be read
+// off err itself rather than off a *elastic.Response, which PerformRequest does not return
+// alongside a non-nil err.
+func isPITExpiredErr(err error) bool {
+	if elastic.IsNotFound(err) {
+		return true
+	}
+	if !elastic.IsStatusCode(err, http.StatusBadRequest) {
+		return false
+	}
+	var eerr *elastic.Error
+	if !errors.As(err, &eerr) || eerr.Details == nil {
+		return bytes.Contains([]byte(err.Error()), []byte("search_context_missing_exception")) ||
+			bytes.Contains([]byte(err.Error()), []byte("Cannot parse search context"))
+	}
+	return eerr.Details.Type == "search_context_missing_exception" ||
+		strings.Contains(eerr.Details.Reason, "Cannot parse search context")
+}
+
+func (e *exporter) closePIT(ctx context.Context) (err error) {
+	if e.pitID == "" {
+		return
+	}
+	_, err = e.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodDelete,
+		Path:   "/_pit",
+		Body: map[string]interface{}{
+			"id": e.pitID,
+		},
+	})
+	return
+}
+
+// searchAfterSort returns the tiebreakable sort clause for ModeSearchAfter, defaulting to
+// [{_shard_doc: asc}] as recommended for PIT searches when Options.Sort is unset.
+func (e *exporter) searchAfterSort() (sort []interface{}, err error) {
+	if len(e.Sort) == 0 {
+		return []interface{}{map[string]interface{}{"_shard_doc": "asc"}}, nil
+	}
+	sort = make([]interface{}, len(e.Sort))
+	for i, s := range e.Sort {
+		if sort[i], err = s.Source(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (e *exporter) doSearchAfter(ctx context.Context) (err error) {
+	var sort []interface{}
+	if sort, err = e.searchAfterSort(); err != nil {
+		return
+	}
+	var body map[string]interface{}
+	if body, err = e.buildSearchBody(e.size, sort); err != nil {
+		return
+	}
+	body["pit"] = map[string]interface{}{
+		"id":         e.pitID,
+		"keep_alive": e.PITKeepAlive,
+	}
+	if len(e.lastSort) > 0 {
+		body["search_after"] = e.lastSort
+	}
+
+	var res *elastic.Response
+	if res, err = e.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   "/_search",
+		Body:   body,
+	}); err != nil {
+		if isPITExpiredErr(err) {
+			err = &pitExpiredError{cause: err}
+		}
+		return
+	}
+
+	buf := res.Body
+
+	// the PIT id may rotate between requests, see
+	// https://www.elastic.co/guide/en/elasticsearch/reference/7.10/point-in-time-api.html
+	if pitID, perr := jsonparser.GetString(buf, "pit_id"); perr == nil && pitID != "" {
+		e.pitID = pitID
+	}
+
+	var shardsFailed int64
+	if shardsFailed, err = jsonparser.GetInt(buf, "_shards", "failed"); err != nil {
+		return
+	}
+	if shardsFailed != 0 {
+		err = errors.New("_shards.failed != 0")
+		return
+	}
+
+	var total int64
+	var totalRelation string
+	if total, totalRelation, err = parseHitsTotal(buf); err != nil {
+		return
+	}
+
+	var hitsBuf []byte
+	var hitsType jsonparser.ValueType
+	if hitsBuf, hitsType, _, err = jsonparser.Get(buf, "hits", "hits"); err != nil {
+		return
+	}
+	if hitsType != jsonparser.Array {
+		err = errors.New("hits.hits is not array")
+		return
+	}
+
+	var itErr error
+	var itCalled bool
+	_, _ = jsonparser.ArrayEach(hitsBuf, func(value []byte, dataType jsonparser.ValueType, offset int, docErr error) {
+		itCalled = true
+		if itErr != nil {
+			return
+		}
+		if docErr != nil {
+			itErr = docErr
+			return
+		}
+		if sortBuf, _, _, sortErr := jsonparser.Get(value, "sort"); sortErr == nil {
+			var lastSort []interface{}
+			if jerr := json.Unmarshal(sortBuf, &lastSort); jerr == nil {
+				e.lastSort = lastSort
+			}
+		}
+
+		prg := Progress{Cursor: e.cursor, Total: total, TotalRelation: totalRelation}
+		if e.IncludeMetadata {
+			var hit Hit
+			if hit, itErr = parseHit(value); itErr != nil {
+				return
+			}
+			itErr = e.hitHandler(hit, prg)
+		} else {
+			var srcBuf []byte
+			var srcType jsonparser.ValueType
+			var srcErr error
+			if srcBuf, srcType, _, srcErr = jsonparser.Get(value, "_source"); srcErr != nil {
+				itErr = srcErr
+				return
+			}
+			if srcType != jsonparser.Object {
+				itErr = errors.New("missing _source in hits.hits")
+				return
+			}
+			itErr = e.handler(srcBuf, prg)
+		}
+		if itErr != nil {
+			return
+		}
+		e.cursor = e.cursor + 1
+	})
+
+	if itErr != nil {
+		err = itErr
+		return
+	}
+
+	if !itCalled {
+		err = io.EOF
+		return
+	}
+
+	return
+}
+
+// doResumable drives ModeSearchAfter, persisting a checkpoint after every successful batch so a
+// crashed or cancelled export can reopen the PIT (or seed search_after from the last sort key)
+// and resume rather than restarting the full scan.
+func (e *exporter) doResumable(ctx context.Context) (err error) {
+	defer e.closePIT(context.Background())
+
+	var cp checkpoint
+	var ok bool
+	if cp, ok, err = e.loadCheckpoint(); err != nil {
+		return
+	}
+	if ok {
+		e.pitID = cp.PITID
+		e.lastSort = cp.LastSort
+		e.cursor = cp.Cursor
+	}
+
+	if e.pitID == "" {
+		if e.pitID, err = e.openPIT(ctx); err != nil {
+			return
+		}
+	}
+
+	if err = e.estimateBatchSize(ctx); err != nil {
+		return
+	}
+
+	pitRetries := 0
+	for {
+		if err = e.doSearchAfter(ctx); err != nil {
+			var expired *pitExpiredError
+			if errors.As(err, &expired) && pitRetries < 1 {
+				// the PIT we resumed with (or last rotated to) is gone; open a fresh one and
+				// keep retrying from e.lastSort, which still holds the last persisted sort key
+				pitRetries++
+				e.pitID = ""
+				if e.pitID, err = e.openPIT(ctx); err != nil {
+					return
+				}
+				continue
+			}
+			if err == ErrUserCancelled || err == io.EOF {
+				if err == io.EOF {
+					if cerr := e.clearCheckpoint(); cerr != nil {
+						err = cerr
+						return
+					}
+				}
+				err = nil
+			}
+			return
+		}
+		pitRetries = 0
+		if err = e.saveCheckpoint(checkpoint{PITID: e.pitID, LastSort: e.lastSort, Cursor: e.cursor}); err != nil {
+			return
+		}
+	}
+}
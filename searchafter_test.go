@@ -0,0 +1,230 @@
+package esexporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/olivere/elastic"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// memCheckpoint is a minimal in-memory checkpointSink (io.ReadWriter + io.Seeker +
+// Truncate), standing in for *os.File in tests that shouldn't touch disk.
+type memCheckpoint struct {
+	buf []byte
+	pos int64
+}
+
+func (m *memCheckpoint) Read(p []byte) (n int, err error) {
+	if m.pos >= int64(len(m.buf)) {
+		return 0, io.EOF
+	}
+	n = copy(p, m.buf[m.pos:])
+	m.pos += int64(n)
+	return
+}
+
+func (m *memCheckpoint) Write(p []byte) (n int, err error) {
+	m.buf = append(m.buf[:m.pos], p...)
+	m.pos += int64(len(p))
+	return len(p), nil
+}
+
+func (m *memCheckpoint) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart || offset != 0 {
+		return 0, errors.New("memCheckpoint: only Seek(0, io.SeekStart) is supported")
+	}
+	m.pos = 0
+	return 0, nil
+}
+
+func (m *memCheckpoint) Truncate(size int64) error {
+	if size != 0 {
+		return errors.New("memCheckpoint: only Truncate(0) is supported")
+	}
+	m.buf = m.buf[:0]
+	return nil
+}
+
+func TestSaveLoadCheckpoint_Path(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	e := &exporter{Options: Options{CheckpointPath: path}}
+
+	want := checkpoint{PITID: "pit-1", LastSort: []interface{}{float64(42)}, Cursor: 7}
+	if err := e.saveCheckpoint(want); err != nil {
+		t.Fatalf("saveCheckpoint: %v", err)
+	}
+
+	got, ok, err := e.loadCheckpoint()
+	if err != nil {
+		t.Fatalf("loadCheckpoint: %v", err)
+	}
+	if !ok {
+		t.Fatalf("loadCheckpoint: expected ok=true")
+	}
+	if got.PITID != want.PITID || got.Cursor != want.Cursor {
+		t.Fatalf("loadCheckpoint: got %+v, want %+v", got, want)
+	}
+
+	// a second save must overwrite, not append
+	want2 := checkpoint{PITID: "pit-2", Cursor: 99}
+	if err := e.saveCheckpoint(want2); err != nil {
+		t.Fatalf("saveCheckpoint (2nd): %v", err)
+	}
+	got2, _, err := e.loadCheckpoint()
+	if err != nil {
+		t.Fatalf("loadCheckpoint (2nd): %v", err)
+	}
+	if got2.PITID != want2.PITID || got2.Cursor != want2.Cursor {
+		t.Fatalf("loadCheckpoint (2nd): got %+v, want %+v", got2, want2)
+	}
+
+	if err := e.clearCheckpoint(); err != nil {
+		t.Fatalf("clearCheckpoint: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("clearCheckpoint: expected %s to be removed, stat err=%v", path, err)
+	}
+}
+
+func TestSaveLoadCheckpoint_SeekableSink(t *testing.T) {
+	sink := &memCheckpoint{}
+	e := &exporter{Options: Options{Checkpoint: sink}}
+
+	if err := e.saveCheckpoint(checkpoint{PITID: "a", Cursor: 1}); err != nil {
+		t.Fatalf("saveCheckpoint: %v", err)
+	}
+	if err := e.saveCheckpoint(checkpoint{PITID: "b", Cursor: 2}); err != nil {
+		t.Fatalf("saveCheckpoint (2nd): %v", err)
+	}
+
+	var cp checkpoint
+	if err := json.Unmarshal(sink.buf, &cp); err != nil {
+		t.Fatalf("second save left invalid JSON (likely appended instead of overwritten): %v (%s)", err, sink.buf)
+	}
+	if cp.PITID != "b" || cp.Cursor != 2 {
+		t.Fatalf("got %+v, want PITID=b Cursor=2", cp)
+	}
+
+	if err := e.clearCheckpoint(); err != nil {
+		t.Fatalf("clearCheckpoint: %v", err)
+	}
+	if len(sink.buf) != 0 {
+		t.Fatalf("clearCheckpoint: expected empty buffer, got %q", sink.buf)
+	}
+}
+
+func TestSaveCheckpoint_NonSeekableSinkErrors(t *testing.T) {
+	e := &exporter{Options: Options{Checkpoint: &nonSeekableBuffer{}}}
+	if err := e.saveCheckpoint(checkpoint{PITID: "a"}); err == nil {
+		t.Fatal("expected an error for a Checkpoint that cannot be rewound/truncated")
+	}
+}
+
+// nonSeekableBuffer is an io.ReadWriter that does not implement io.Seeker/Truncate, e.g.
+// the natural choice of a bare *bytes.Buffer as Options.Checkpoint.
+type nonSeekableBuffer struct {
+	buf []byte
+}
+
+func (b *nonSeekableBuffer) Read(p []byte) (int, error) {
+	n := copy(p, b.buf)
+	return n, nil
+}
+
+func (b *nonSeekableBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func TestSearchAfterSort_Default(t *testing.T) {
+	e := &exporter{}
+	sort, err := e.searchAfterSort()
+	if err != nil {
+		t.Fatalf("searchAfterSort: %v", err)
+	}
+	want := []interface{}{map[string]interface{}{"_shard_doc": "asc"}}
+	if fmt.Sprint(sort) != fmt.Sprint(want) {
+		t.Fatalf("got %+v, want %+v", sort, want)
+	}
+}
+
+func TestSearchAfterSort_Custom(t *testing.T) {
+	e := &exporter{Options: Options{Sort: []elastic.Sorter{elastic.NewFieldSort("created_at").Asc()}}}
+	sort, err := e.searchAfterSort()
+	if err != nil {
+		t.Fatalf("searchAfterSort: %v", err)
+	}
+	if len(sort) != 1 {
+		t.Fatalf("got %d sort clauses, want 1", len(sort))
+	}
+}
+
+// newPITExpiryTestServer fakes just enough of the PIT + search_after API to exercise doResumable's
+// reopen-on-expiry path: the first /_search against "pit-old" is rejected as expired, the
+// exporter reopens a fresh PIT, and the retried /_search succeeds with a single hit, then EOF.
+func newPITExpiryTestServer(t *testing.T) *httptest.Server {
+	var pitOpens int
+	var searches int
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/":
+			_, _ = w.Write([]byte(`{"version":{"number":"7.10.2"}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/idx/_pit":
+			pitOpens++
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"id":"pit-%d"}`, pitOpens)))
+		case r.Method == http.MethodPost && r.URL.Path == "/idx/_doc/_search":
+			// estimateBatchSize's sampling request, unrelated to the PIT/search_after path
+			_, _ = w.Write([]byte(`{"_shards":{"failed":0},"hits":{"total":1,"hits":[{"_source":{"a":1}}]}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/_search":
+			searches++
+			switch searches {
+			case 1:
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":{"type":"search_context_missing_exception","reason":"No search context found"}}`))
+			case 2:
+				_, _ = w.Write([]byte(`{"pit_id":"pit-2","_shards":{"failed":0},"hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_source":{"a":1},"sort":[1]}]}}`))
+			default:
+				// no more hits: doSearchAfter reports io.EOF and doResumable stops looping
+				_, _ = w.Write([]byte(`{"pit_id":"pit-2","_shards":{"failed":0},"hits":{"total":{"value":1,"relation":"eq"},"hits":[]}}`))
+			}
+		case r.Method == http.MethodDelete:
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+}
+
+func TestDoResumable_ReopensExpiredPIT(t *testing.T) {
+	ts := newPITExpiryTestServer(t)
+	defer ts.Close()
+
+	client, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatalf("elastic.NewClient: %v", err)
+	}
+
+	var delivered int
+	h := SourceHandler(func(buf []byte, prg Progress) error {
+		delivered++
+		return nil
+	})
+
+	e := New(client, Options{Index: "idx", Mode: ModeSearchAfter}, h).(*exporter)
+	// simulate a resumed run whose persisted PIT has since expired
+	e.pitID = "pit-old"
+
+	if err := e.Do(context.Background()); err != nil {
+		t.Fatalf("Do: %v", err)
+	}
+	if delivered != 1 {
+		t.Fatalf("got %d delivered docs, want 1", delivered)
+	}
+}
@@ -0,0 +1,179 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/olivere/elastic"
+	"net/http"
+	"time"
+)
+
+// BulkOptions configures NewBulkSink.
+type BulkOptions struct {
+	// Index and Type are the target of the reindex; when either is empty, the written
+	// document's DocMeta.Index/DocMeta.Type is used instead, and _type is omitted from
+	// actions when both Type and DocMeta.Type are empty.
+	Index string
+	Type  string
+
+	// BatchCount and BatchByteSize bound how many documents/bytes accumulate before an
+	// automatic Flush; whichever is reached first triggers the flush.
+	BatchCount    int
+	BatchByteSize int64
+
+	// MaxRetries bounds the exponential backoff retried on HTTP 429/503 responses.
+	MaxRetries int
+
+	// OnItemError, if set, is called for every _bulk response item that reports an error,
+	// letting callers dump rejects to a dead-letter file instead of failing the whole batch.
+	OnItemError func(doc []byte, meta DocMeta, reason string)
+}
+
+type pendingDoc struct {
+	doc  []byte
+	meta DocMeta
+}
+
+// BulkSink batches documents into Elasticsearch `_bulk` index actions against a target
+// cluster/index, implemented directly on elastic.Client.PerformRequest to avoid a hard
+// dependency on olivere/elastic's BulkProcessor.
+type BulkSink struct {
+	client *elastic.Client
+	opts   BulkOptions
+
+	buf     bytes.Buffer
+	pending []pendingDoc
+}
+
+func NewBulkSink(client *elastic.Client, opts BulkOptions) *BulkSink {
+	if opts.BatchCount <= 0 {
+		opts.BatchCount = 1000
+	}
+	if opts.BatchByteSize <= 0 {
+		opts.BatchByteSize = 10 * 1024 * 1024
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 5
+	}
+	return &BulkSink{client: client, opts: opts}
+}
+
+func (s *BulkSink) Write(doc []byte, meta DocMeta) (err error) {
+	index := s.opts.Index
+	if index == "" {
+		index = meta.Index
+	}
+	typ := s.opts.Type
+	if typ == "" {
+		typ = meta.Type
+	}
+
+	action := map[string]interface{}{"_index": index}
+	if typ != "" {
+		action["_type"] = typ
+	}
+	if meta.ID != "" {
+		action["_id"] = meta.ID
+	}
+	if meta.Routing != "" {
+		action["routing"] = meta.Routing
+	}
+
+	var actionBuf []byte
+	if actionBuf, err = json.Marshal(map[string]interface{}{"index": action}); err != nil {
+		return
+	}
+
+	s.buf.Write(actionBuf)
+	s.buf.WriteByte('\n')
+	s.buf.Write(doc)
+	s.buf.WriteByte('\n')
+	s.pending = append(s.pending, pendingDoc{doc: doc, meta: meta})
+
+	if len(s.pending) >= s.opts.BatchCount || int64(s.buf.Len()) >= s.opts.BatchByteSize {
+		return s.Flush()
+	}
+	return nil
+}
+
+func (s *BulkSink) Flush() (err error) {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	body := make([]byte, s.buf.Len())
+	copy(body, s.buf.Bytes())
+	pending := s.pending
+
+	s.buf.Reset()
+	s.pending = nil
+
+	return s.sendWithRetry(body, pending)
+}
+
+func (s *BulkSink) sendWithRetry(body []byte, pending []pendingDoc) (err error) {
+	backoff := 200 * time.Millisecond
+	for attempt := 0; attempt <= s.opts.MaxRetries; attempt++ {
+		var res *elastic.Response
+		res, err = s.client.PerformRequest(context.Background(), elastic.PerformRequestOptions{
+			Method: http.MethodPost,
+			Path:   "/_bulk",
+			Body:   string(body),
+		})
+		if err != nil {
+			// PerformRequest turns any non-2xx response into a non-nil err, so the
+			// retryable-status check must read err itself rather than res.StatusCode.
+			if elastic.IsStatusCode(err, http.StatusTooManyRequests) || elastic.IsStatusCode(err, http.StatusServiceUnavailable) {
+				time.Sleep(backoff)
+				backoff *= 2
+				continue
+			}
+			return
+		}
+
+		return s.reportItemErrors(res.Body, pending)
+	}
+	return fmt.Errorf("bulk request exhausted %d retries", s.opts.MaxRetries)
+}
+
+// reportItemErrors scans the _bulk response for per-item failures (e.g. mapping or version
+// conflicts, which a 200 bulk response can still carry item-by-item). When OnItemError is
+// set it is called for every failed item and the batch is otherwise considered handled; when
+// it is unset there is no one else to see the failures, so reportItemErrors aggregates them
+// into a returned error instead of letting Flush report success while silently dropping
+// documents that never made it into the target index.
+func (s *BulkSink) reportItemErrors(resBuf []byte, pending []pendingDoc) (err error) {
+	var itemsBuf []byte
+	if itemsBuf, _, _, err = jsonparser.Get(resBuf, "items"); err != nil {
+		return nil
+	}
+
+	var failed int
+	i := 0
+	_, _ = jsonparser.ArrayEach(itemsBuf, func(value []byte, dataType jsonparser.ValueType, offset int, itemErr error) {
+		defer func() { i++ }()
+		if i >= len(pending) {
+			return
+		}
+		errBuf, _, _, gerr := jsonparser.Get(value, "index", "error")
+		if gerr != nil {
+			return
+		}
+		failed++
+		if s.opts.OnItemError != nil {
+			s.opts.OnItemError(pending[i].doc, pending[i].meta, string(errBuf))
+		}
+	})
+
+	if failed > 0 && s.opts.OnItemError == nil {
+		return fmt.Errorf("bulk request: %d/%d items failed to index, set BulkOptions.OnItemError to inspect them", failed, len(pending))
+	}
+	return nil
+}
+
+func (s *BulkSink) Close() error {
+	return s.Flush()
+}
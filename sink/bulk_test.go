@@ -0,0 +1,122 @@
+package sink
+
+import (
+	"github.com/olivere/elastic"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestClient(t *testing.T, ts *httptest.Server) *elastic.Client {
+	t.Helper()
+	client, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatalf("elastic.NewClient: %v", err)
+	}
+	return client
+}
+
+func TestBulkSink_FlushesAtBatchCount(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte(`{"items":[{"index":{"status":201}},{"index":{"status":201}}]}`))
+	}))
+	defer ts.Close()
+
+	s := NewBulkSink(newTestClient(t, ts), BulkOptions{Index: "dst", BatchCount: 2})
+
+	if err := s.Write([]byte(`{"a":1}`), DocMeta{}); err != nil {
+		t.Fatalf("Write 1: %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Fatalf("expected no flush before BatchCount is reached, got %d requests", requests)
+	}
+	if err := s.Write([]byte(`{"a":2}`), DocMeta{}); err != nil {
+		t.Fatalf("Write 2: %v", err)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Fatalf("expected exactly one flush once BatchCount is reached, got %d requests", requests)
+	}
+}
+
+func TestBulkSink_RetriesOn429ThenSucceeds(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&attempts, 1)
+		if n < 3 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte(`{"items":[{"index":{"status":201}}]}`))
+	}))
+	defer ts.Close()
+
+	s := NewBulkSink(newTestClient(t, ts), BulkOptions{Index: "dst", BatchCount: 1})
+	if err := s.Write([]byte(`{"a":1}`), DocMeta{}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Fatalf("got %d attempts, want 3 (2 failures + 1 success)", got)
+	}
+}
+
+func TestBulkSink_ExhaustsRetries(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	s := NewBulkSink(newTestClient(t, ts), BulkOptions{Index: "dst", BatchCount: 1, MaxRetries: 2})
+	err := s.Write([]byte(`{"a":1}`), DocMeta{})
+	if err == nil {
+		t.Fatal("expected an error once retries are exhausted")
+	}
+}
+
+func TestBulkSink_ItemErrors_AggregatedWhenNoCallback(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"items":[
+			{"index":{"status":201}},
+			{"index":{"status":409,"error":{"type":"version_conflict_engine_exception","reason":"conflict"}}}
+		]}`))
+	}))
+	defer ts.Close()
+
+	s := NewBulkSink(newTestClient(t, ts), BulkOptions{Index: "dst", BatchCount: 2})
+	_ = s.Write([]byte(`{"a":1}`), DocMeta{})
+	err := s.Write([]byte(`{"a":2}`), DocMeta{})
+	if err == nil {
+		t.Fatal("expected Flush to surface the failed item when OnItemError is unset")
+	}
+	if !strings.Contains(err.Error(), "1/2") {
+		t.Fatalf("expected error to mention 1/2 failed items, got: %v", err)
+	}
+}
+
+func TestBulkSink_ItemErrors_CallbackSuppressesAggregateError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"items":[
+			{"index":{"status":409,"error":{"type":"version_conflict_engine_exception","reason":"conflict"}}}
+		]}`))
+	}))
+	defer ts.Close()
+
+	var callbackReason string
+	s := NewBulkSink(newTestClient(t, ts), BulkOptions{
+		Index:      "dst",
+		BatchCount: 1,
+		OnItemError: func(doc []byte, meta DocMeta, reason string) {
+			callbackReason = reason
+		},
+	})
+
+	if err := s.Write([]byte(`{"a":1}`), DocMeta{}); err != nil {
+		t.Fatalf("expected no error when OnItemError is registered, got: %v", err)
+	}
+	if callbackReason == "" {
+		t.Fatal("expected OnItemError to be called with the failure reason")
+	}
+}
@@ -0,0 +1,65 @@
+package sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// NDJSONOptions configures NewNDJSONSink.
+type NDJSONOptions struct {
+	// Path is the file to write, truncated if it already exists.
+	Path string
+	// Gzip, if set, wraps the file in a gzip.Writer.
+	Gzip bool
+}
+
+// NDJSONSink writes each document as one line of newline-delimited JSON, optionally gzip
+// compressed.
+type NDJSONSink struct {
+	bw      *bufio.Writer
+	closers []io.Closer
+}
+
+func NewNDJSONSink(opts NDJSONOptions) (*NDJSONSink, error) {
+	f, err := os.Create(opts.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &NDJSONSink{closers: []io.Closer{f}}
+
+	var w io.Writer = f
+	if opts.Gzip {
+		gz := gzip.NewWriter(f)
+		s.closers = append([]io.Closer{gz}, s.closers...)
+		w = gz
+	}
+	s.bw = bufio.NewWriter(w)
+
+	return s, nil
+}
+
+func (s *NDJSONSink) Write(doc []byte, meta DocMeta) (err error) {
+	if _, err = s.bw.Write(doc); err != nil {
+		return
+	}
+	return s.bw.WriteByte('\n')
+}
+
+func (s *NDJSONSink) Flush() error {
+	return s.bw.Flush()
+}
+
+func (s *NDJSONSink) Close() (err error) {
+	if err = s.bw.Flush(); err != nil {
+		return
+	}
+	for _, c := range s.closers {
+		if err = c.Close(); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,72 @@
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNDJSONSink_WritesPlainLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	s, err := NewNDJSONSink(NDJSONOptions{Path: path})
+	if err != nil {
+		t.Fatalf("NewNDJSONSink: %v", err)
+	}
+
+	if err := s.Write([]byte(`{"a":1}`), DocMeta{}); err != nil {
+		t.Fatalf("Write 1: %v", err)
+	}
+	if err := s.Write([]byte(`{"a":2}`), DocMeta{}); err != nil {
+		t.Fatalf("Write 2: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	want := "{\"a\":1}\n{\"a\":2}\n"
+	if string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestNDJSONSink_Gzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.ndjson.gz")
+	s, err := NewNDJSONSink(NDJSONOptions{Path: path, Gzip: true})
+	if err != nil {
+		t.Fatalf("NewNDJSONSink: %v", err)
+	}
+
+	if err := s.Write([]byte(`{"a":1}`), DocMeta{}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader: %v (file was not written as gzip)", err)
+	}
+	defer gr.Close()
+
+	var out bytes.Buffer
+	if _, err := out.ReadFrom(bufio.NewReader(gr)); err != nil {
+		t.Fatalf("reading gzip contents: %v", err)
+	}
+	if want := "{\"a\":1}\n"; out.String() != want {
+		t.Fatalf("got %q, want %q", out.String(), want)
+	}
+}
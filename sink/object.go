@@ -0,0 +1,74 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// Uploader abstracts the subset of an S3-compatible client used by ObjectSink, so this
+// package can support S3 (or any other object store) without taking a hard dependency on
+// the AWS SDK; callers can adapt *s3manager.Uploader, a MinIO client, or a test double.
+type Uploader interface {
+	Upload(ctx context.Context, bucket, key string, body []byte) error
+}
+
+// ObjectSinkOptions configures NewObjectSink.
+type ObjectSinkOptions struct {
+	Bucket    string
+	KeyPrefix string
+
+	// BatchCount and BatchByteSize bound how many documents/bytes accumulate into one
+	// uploaded object; whichever is reached first triggers the upload.
+	BatchCount    int
+	BatchByteSize int64
+}
+
+// ObjectSink buffers documents as newline-delimited JSON and uploads one object per batch
+// to an S3-compatible object store via Uploader.
+type ObjectSink struct {
+	uploader Uploader
+	opts     ObjectSinkOptions
+
+	buf   bytes.Buffer
+	count int
+	part  int
+}
+
+func NewObjectSink(uploader Uploader, opts ObjectSinkOptions) *ObjectSink {
+	if opts.BatchCount <= 0 {
+		opts.BatchCount = 10000
+	}
+	if opts.BatchByteSize <= 0 {
+		opts.BatchByteSize = 64 * 1024 * 1024
+	}
+	return &ObjectSink{uploader: uploader, opts: opts}
+}
+
+func (s *ObjectSink) Write(doc []byte, meta DocMeta) (err error) {
+	s.buf.Write(doc)
+	s.buf.WriteByte('\n')
+	s.count++
+	if s.count >= s.opts.BatchCount || int64(s.buf.Len()) >= s.opts.BatchByteSize {
+		return s.Flush()
+	}
+	return nil
+}
+
+func (s *ObjectSink) Flush() (err error) {
+	if s.count == 0 {
+		return nil
+	}
+	key := fmt.Sprintf("%s%06d.ndjson", s.opts.KeyPrefix, s.part)
+	if err = s.uploader.Upload(context.Background(), s.opts.Bucket, key, s.buf.Bytes()); err != nil {
+		return
+	}
+	s.part++
+	s.buf.Reset()
+	s.count = 0
+	return
+}
+
+func (s *ObjectSink) Close() error {
+	return s.Flush()
+}
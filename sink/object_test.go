@@ -0,0 +1,98 @@
+package sink
+
+import (
+	"context"
+	"testing"
+)
+
+// fakeUploader is a minimal in-memory Uploader, recording every object it was asked to
+// upload instead of talking to a real object store.
+type fakeUploader struct {
+	uploads []struct {
+		bucket, key string
+		body        string
+	}
+}
+
+func (u *fakeUploader) Upload(ctx context.Context, bucket, key string, body []byte) error {
+	u.uploads = append(u.uploads, struct {
+		bucket, key string
+		body        string
+	}{bucket, key, string(body)})
+	return nil
+}
+
+func TestObjectSink_FlushesAtBatchCount(t *testing.T) {
+	u := &fakeUploader{}
+	s := NewObjectSink(u, ObjectSinkOptions{Bucket: "b", KeyPrefix: "p/", BatchCount: 2})
+
+	if err := s.Write([]byte(`{"a":1}`), DocMeta{}); err != nil {
+		t.Fatalf("Write 1: %v", err)
+	}
+	if len(u.uploads) != 0 {
+		t.Fatalf("expected no upload before BatchCount is reached, got %d", len(u.uploads))
+	}
+	if err := s.Write([]byte(`{"a":2}`), DocMeta{}); err != nil {
+		t.Fatalf("Write 2: %v", err)
+	}
+	if len(u.uploads) != 1 {
+		t.Fatalf("expected exactly one upload once BatchCount is reached, got %d", len(u.uploads))
+	}
+	if want := "p/000000.ndjson"; u.uploads[0].key != want {
+		t.Fatalf("got key %q, want %q", u.uploads[0].key, want)
+	}
+	if want := "{\"a\":1}\n{\"a\":2}\n"; u.uploads[0].body != want {
+		t.Fatalf("got body %q, want %q", u.uploads[0].body, want)
+	}
+}
+
+func TestObjectSink_FlushesAtBatchByteSize(t *testing.T) {
+	u := &fakeUploader{}
+	s := NewObjectSink(u, ObjectSinkOptions{Bucket: "b", BatchCount: 1000, BatchByteSize: 4})
+
+	if err := s.Write([]byte(`{"a":1}`), DocMeta{}); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if len(u.uploads) != 1 {
+		t.Fatalf("expected an upload once BatchByteSize is exceeded, got %d", len(u.uploads))
+	}
+}
+
+func TestObjectSink_CloseFlushesRemainderAndIncrementsPart(t *testing.T) {
+	u := &fakeUploader{}
+	s := NewObjectSink(u, ObjectSinkOptions{Bucket: "b", KeyPrefix: "p/", BatchCount: 2})
+
+	if err := s.Write([]byte(`{"a":1}`), DocMeta{}); err != nil {
+		t.Fatalf("Write 1: %v", err)
+	}
+	if err := s.Write([]byte(`{"a":2}`), DocMeta{}); err != nil {
+		t.Fatalf("Write 2: %v", err)
+	}
+	if err := s.Write([]byte(`{"a":3}`), DocMeta{}); err != nil {
+		t.Fatalf("Write 3: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if len(u.uploads) != 2 {
+		t.Fatalf("got %d uploads, want 2 (one at BatchCount, one flushed on Close)", len(u.uploads))
+	}
+	if want := "p/000001.ndjson"; u.uploads[1].key != want {
+		t.Fatalf("got second upload key %q, want %q (part must increment)", u.uploads[1].key, want)
+	}
+	if want := "{\"a\":3}\n"; u.uploads[1].body != want {
+		t.Fatalf("got second upload body %q, want %q", u.uploads[1].body, want)
+	}
+}
+
+func TestObjectSink_CloseIsNoopWhenEmpty(t *testing.T) {
+	u := &fakeUploader{}
+	s := NewObjectSink(u, ObjectSinkOptions{Bucket: "b"})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if len(u.uploads) != 0 {
+		t.Fatalf("expected no upload for an empty sink, got %d", len(u.uploads))
+	}
+}
@@ -0,0 +1,48 @@
+// Package sink provides pluggable write destinations for esexporter, so an export can be
+// routed to a file, a target Elasticsearch cluster, or an object store instead of a single
+// in-process SourceHandler.
+package sink
+
+import "github.com/guoyk93/esdump"
+
+// DocMeta carries the document identity alongside its body, so a Sink can reindex with the
+// original _id/_routing instead of letting the target cluster assign new ones.
+type DocMeta struct {
+	Index   string
+	Type    string
+	ID      string
+	Routing string
+}
+
+// Sink is a pluggable write destination for exported documents. Write may buffer
+// internally; Flush forces any buffered documents out, and Close releases underlying
+// resources after a final Flush.
+type Sink interface {
+	Write(doc []byte, meta DocMeta) error
+	Flush() error
+	Close() error
+}
+
+// Adapt turns a Sink into an esexporter.SourceHandler, so existing esexporter.Options-based
+// exports can write through a Sink without changing how the exporter itself is driven.
+// index and type are attached to every DocMeta since a plain SourceHandler carries no
+// per-hit metadata; use AdaptHits with Options.IncludeMetadata to preserve _id/_routing.
+func Adapt(s Sink, index, typ string) esexporter.SourceHandler {
+	return func(buf []byte, prg esexporter.Progress) error {
+		return s.Write(buf, DocMeta{Index: index, Type: typ})
+	}
+}
+
+// AdaptHits turns a Sink into an esexporter.HitHandler for use with esexporter.NewWithHits,
+// carrying each hit's _index/_type/_id/_routing into DocMeta so a reindex preserves document
+// identity instead of letting the target cluster assign new ids.
+func AdaptHits(s Sink) esexporter.HitHandler {
+	return func(hit esexporter.Hit, prg esexporter.Progress) error {
+		return s.Write(hit.Source, DocMeta{
+			Index:   hit.Index,
+			Type:    hit.Type,
+			ID:      hit.ID,
+			Routing: hit.Routing,
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package sink
+
+import (
+	"errors"
+	"github.com/guoyk93/esdump"
+	"testing"
+)
+
+// fakeSink is a minimal in-memory Sink, recording every write instead of touching a real
+// destination.
+type fakeSink struct {
+	writes []struct {
+		doc  string
+		meta DocMeta
+	}
+}
+
+func (s *fakeSink) Write(doc []byte, meta DocMeta) error {
+	s.writes = append(s.writes, struct {
+		doc  string
+		meta DocMeta
+	}{string(doc), meta})
+	return nil
+}
+
+func (s *fakeSink) Flush() error { return nil }
+func (s *fakeSink) Close() error { return nil }
+
+func TestAdapt_AttachesIndexAndType(t *testing.T) {
+	s := &fakeSink{}
+	h := Adapt(s, "idx", "_doc")
+
+	if err := h([]byte(`{"a":1}`), esexporter.Progress{}); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	if len(s.writes) != 1 {
+		t.Fatalf("got %d writes, want 1", len(s.writes))
+	}
+	if s.writes[0].doc != `{"a":1}` || s.writes[0].meta.Index != "idx" || s.writes[0].meta.Type != "_doc" {
+		t.Fatalf("got %+v", s.writes[0])
+	}
+}
+
+func TestAdaptHits_CarriesHitMetadata(t *testing.T) {
+	s := &fakeSink{}
+	h := AdaptHits(s)
+
+	hit := esexporter.Hit{Index: "idx", Type: "_doc", ID: "1", Routing: "r", Source: []byte(`{"a":1}`)}
+	if err := h(hit, esexporter.Progress{}); err != nil {
+		t.Fatalf("handler: %v", err)
+	}
+	if len(s.writes) != 1 {
+		t.Fatalf("got %d writes, want 1", len(s.writes))
+	}
+	got := s.writes[0]
+	if got.doc != `{"a":1}` || got.meta.Index != "idx" || got.meta.Type != "_doc" || got.meta.ID != "1" || got.meta.Routing != "r" {
+		t.Fatalf("got %+v", got)
+	}
+}
+
+func TestAdapt_PropagatesWriteError(t *testing.T) {
+	wantErr := errors.New("boom")
+	h := Adapt(erroringSink{err: wantErr}, "idx", "_doc")
+	if err := h([]byte(`{}`), esexporter.Progress{}); err != wantErr {
+		t.Fatalf("handler err = %v, want %v", err, wantErr)
+	}
+}
+
+type erroringSink struct{ err error }
+
+func (s erroringSink) Write(doc []byte, meta DocMeta) error { return s.err }
+func (s erroringSink) Flush() error                         { return nil }
+func (s erroringSink) Close() error                         { return nil }
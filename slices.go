@@ -0,0 +1,229 @@
+package esexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/olivere/elastic"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// ConcurrentSourceHandler is the Slices variant of SourceHandler: it additionally receives
+// the id of the slice that produced the batch, letting callers route output per-slice
+// instead of synchronizing on a single SourceHandler.
+type ConcurrentSourceHandler func(buf []byte, slice int, prg Progress) error
+
+// NewConcurrent is like New, but accepts a ConcurrentSourceHandler for use with
+// Options.Slices. A handler registered via New still works under Options.Slices; it is
+// simply called without a meaningful slice id.
+func NewConcurrent(client *elastic.Client, opts Options, handler ConcurrentSourceHandler) Exporter {
+	e := New(client, opts, nil).(*exporter)
+	e.concurrentHandler = handler
+	return e
+}
+
+// sliceCoordinator aggregates the per-slice hits.total of a sliced scroll, together with one
+// cursor shared by all slices, into a single global Progress, and serializes ConcurrentSourceHandler calls so slices don't race each
+// other; holding the lock for the duration of a handler call also gives backpressure, since
+// a slow handler blocks every other slice's next delivery.
+type sliceCoordinator struct {
+	mu          sync.Mutex
+	cursor      int64
+	sliceTotals []int64
+	relation    string
+}
+
+func newSliceCoordinator(slices int) *sliceCoordinator {
+	return &sliceCoordinator{sliceTotals: make([]int64, slices)}
+}
+
+func (c *sliceCoordinator) globalTotal() (total int64) {
+	for _, t := range c.sliceTotals {
+		total += t
+	}
+	return
+}
+
+func (c *sliceCoordinator) relationOrDefault() string {
+	if c.relation == "" {
+		return "eq"
+	}
+	return c.relation
+}
+
+// deliver reports a slice's hits.total and invokes handler with a coordinated global
+// Progress, returning handler's error. It is the single synchronization point between
+// slice workers.
+func (c *sliceCoordinator) deliver(sliceID int, total int64, relation string, srcBuf []byte, handler ConcurrentSourceHandler) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sliceTotals[sliceID] = total
+	if relation != "eq" {
+		c.relation = relation
+	}
+	prg := Progress{Cursor: c.cursor, Total: c.globalTotal(), TotalRelation: c.relationOrDefault()}
+	c.cursor++
+	return handler(srcBuf, sliceID, prg)
+}
+
+func (e *exporter) doSliceFetch(ctx context.Context, sliceID, maxSlices int) (res *elastic.Response, err error) {
+	if e.scrollID == "" {
+		var body map[string]interface{}
+		if body, err = e.buildSearchBody(e.size, []string{"_doc"}); err != nil {
+			return
+		}
+		body["slice"] = map[string]interface{}{"id": sliceID, "max": maxSlices}
+		return e.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+			Method: http.MethodPost,
+			Path:   e.buildSearchPath(),
+			Params: url.Values{"scroll": []string{e.Scroll}},
+			Body:   body,
+		})
+	}
+	return e.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: http.MethodPost,
+		Path:   "/_search/scroll",
+		Body: map[string]interface{}{
+			"scroll":    e.Scroll,
+			"scroll_id": e.scrollID,
+		},
+	})
+}
+
+// doSlice fetches and delivers one batch of one slice, mirroring exporter.do but reporting
+// through a sliceCoordinator instead of a local cursor.
+func (e *exporter) doSlice(ctx context.Context, sliceID, maxSlices int, coord *sliceCoordinator, handler ConcurrentSourceHandler) (err error) {
+	var res *elastic.Response
+	if res, err = e.doSliceFetch(ctx, sliceID, maxSlices); err != nil {
+		return
+	}
+
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("http request failed: %d: %s", res.StatusCode, res.Body)
+		return
+	}
+
+	buf := res.Body
+
+	if e.scrollID, err = jsonparser.GetString(buf, "_scroll_id"); err != nil {
+		return
+	}
+
+	var shardsFailed int64
+	if shardsFailed, err = jsonparser.GetInt(buf, "_shards", "failed"); err != nil {
+		return
+	}
+	if shardsFailed != 0 {
+		err = errors.New("_shards.failed != 0")
+		return
+	}
+
+	var total int64
+	var relation string
+	if total, relation, err = parseHitsTotal(buf); err != nil {
+		return
+	}
+
+	var hitsBuf []byte
+	var hitsType jsonparser.ValueType
+	if hitsBuf, hitsType, _, err = jsonparser.Get(buf, "hits", "hits"); err != nil {
+		return
+	}
+	if hitsType != jsonparser.Array {
+		err = errors.New("hits.hits is not array")
+		return
+	}
+
+	var itErr error
+	var itCalled bool
+	_, _ = jsonparser.ArrayEach(hitsBuf, func(value []byte, dataType jsonparser.ValueType, offset int, docErr error) {
+		itCalled = true
+		if itErr != nil {
+			return
+		}
+		if docErr != nil {
+			itErr = docErr
+			return
+		}
+		srcBuf, srcType, _, srcErr := jsonparser.Get(value, "_source")
+		if srcErr != nil {
+			itErr = srcErr
+			return
+		}
+		if srcType != jsonparser.Object {
+			itErr = errors.New("missing _source in hits.hits")
+			return
+		}
+		if itErr = coord.deliver(sliceID, total, relation, srcBuf, handler); itErr != nil {
+			return
+		}
+	})
+
+	if itErr != nil {
+		err = itErr
+		return
+	}
+
+	if !itCalled {
+		err = io.EOF
+		return
+	}
+
+	return
+}
+
+// doSlices fans Options.Slices workers out over a sliced scroll (per the ES sliced scroll
+// API), each with its own scroll cursor, and multiplexes their hits through a
+// sliceCoordinator. The first worker error cancels every sibling via context.WithCancel;
+// every slice's scroll_id is deleted on exit regardless of how the worker stopped. Once a
+// slice triggers the cancellation, its error is recorded as the root cause under causeMu,
+// so a sibling that only ever observes "context canceled" can't race it out and mask why
+// doSlices actually failed.
+func (e *exporter) doSlices(ctx context.Context, handler ConcurrentSourceHandler) (err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	coord := newSliceCoordinator(e.Slices)
+
+	var wg sync.WaitGroup
+	var causeMu sync.Mutex
+	var cause error
+
+	recordCause := func(serr error) {
+		causeMu.Lock()
+		defer causeMu.Unlock()
+		if cause == nil {
+			cause = serr
+		}
+	}
+
+	for i := 0; i < e.Slices; i++ {
+		w := *e
+		wg.Add(1)
+		go func(i int, w *exporter) {
+			defer wg.Done()
+			defer w.deleteScrollID()
+			if serr := w.estimateBatchSize(ctx); serr != nil {
+				recordCause(serr)
+				cancel()
+				return
+			}
+			for {
+				if serr := w.doSlice(ctx, i, e.Slices, coord, handler); serr != nil {
+					if serr != ErrUserCancelled && serr != io.EOF {
+						recordCause(serr)
+						cancel()
+					}
+					return
+				}
+			}
+		}(i, &w)
+	}
+	wg.Wait()
+
+	return cause
+}
@@ -0,0 +1,189 @@
+package esexporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/buger/jsonparser"
+	"github.com/olivere/elastic"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSliceCoordinator_GlobalTotal(t *testing.T) {
+	c := newSliceCoordinator(3)
+	c.sliceTotals = []int64{10, 20, 5}
+	if got := c.globalTotal(); got != 35 {
+		t.Fatalf("globalTotal() = %d, want 35", got)
+	}
+}
+
+func TestSliceCoordinator_RelationOrDefault(t *testing.T) {
+	c := newSliceCoordinator(1)
+	if got := c.relationOrDefault(); got != "eq" {
+		t.Fatalf("relationOrDefault() = %q, want %q (zero value)", got, "eq")
+	}
+	c.relation = "gte"
+	if got := c.relationOrDefault(); got != "gte" {
+		t.Fatalf("relationOrDefault() = %q, want %q", got, "gte")
+	}
+}
+
+func TestSliceCoordinator_Deliver_AggregatesAndSerializes(t *testing.T) {
+	c := newSliceCoordinator(2)
+
+	var mu sync.Mutex
+	var cursors []int64
+
+	handler := ConcurrentSourceHandler(func(buf []byte, slice int, prg Progress) error {
+		mu.Lock()
+		cursors = append(cursors, prg.Cursor)
+		mu.Unlock()
+		return nil
+	})
+
+	if err := c.deliver(0, 100, "eq", []byte(`{}`), handler); err != nil {
+		t.Fatalf("deliver(slice 0): %v", err)
+	}
+	if err := c.deliver(1, 50, "gte", []byte(`{}`), handler); err != nil {
+		t.Fatalf("deliver(slice 1): %v", err)
+	}
+
+	if got := c.globalTotal(); got != 150 {
+		t.Fatalf("globalTotal() = %d, want 150 (100+50 across slices)", got)
+	}
+	if c.relationOrDefault() != "gte" {
+		t.Fatalf("relation = %q, want gte to stick once any slice reports it", c.relationOrDefault())
+	}
+	if len(cursors) != 2 || cursors[0] != 0 || cursors[1] != 1 {
+		t.Fatalf("got cursors %v, want a single monotonically increasing global cursor [0 1]", cursors)
+	}
+}
+
+func TestSliceCoordinator_Deliver_PropagatesHandlerError(t *testing.T) {
+	c := newSliceCoordinator(1)
+	wantErr := errors.New("boom")
+	handler := ConcurrentSourceHandler(func(buf []byte, slice int, prg Progress) error {
+		return wantErr
+	})
+	if err := c.deliver(0, 1, "eq", []byte(`{}`), handler); err != wantErr {
+		t.Fatalf("deliver() err = %v, want %v", err, wantErr)
+	}
+}
+
+// newDoSlicesTestServer fakes just enough of the sliced-scroll API to drive doSlices
+// end-to-end: the estimateBatchSize sample request, one slice-id-tagged initial scroll per
+// slice, and a scroll continuation that reports no more hits so each slice reaches io.EOF.
+func newDoSlicesTestServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var deletes int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/idx/_doc/_search":
+			buf, _ := io.ReadAll(r.Body)
+			if sliceID, serr := jsonparser.GetInt(buf, "slice", "id"); serr == nil {
+				_, _ = w.Write([]byte(fmt.Sprintf(
+					`{"_scroll_id":"scroll-%d","_shards":{"failed":0},"hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_source":{"slice":%d}}]}}`,
+					sliceID, sliceID)))
+				return
+			}
+			// estimateBatchSize's sampling request, unrelated to the per-slice fetch above
+			_, _ = w.Write([]byte(`{"_shards":{"failed":0},"hits":{"total":1,"hits":[]}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/_search/scroll":
+			_, _ = w.Write([]byte(`{"_scroll_id":"scroll-done","_shards":{"failed":0},"hits":{"total":{"value":1,"relation":"eq"},"hits":[]}}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/_search/scroll":
+			atomic.AddInt32(&deletes, 1)
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	return ts, &deletes
+}
+
+func TestDoSlices_DeliversPerSliceAndDeletesEveryScrollID(t *testing.T) {
+	ts, deletes := newDoSlicesTestServer(t)
+	defer ts.Close()
+
+	client, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatalf("elastic.NewClient: %v", err)
+	}
+
+	e := New(client, Options{Index: "idx", Slices: 2}, nil).(*exporter)
+
+	var mu sync.Mutex
+	delivered := map[int]int{}
+	handler := ConcurrentSourceHandler(func(buf []byte, slice int, prg Progress) error {
+		mu.Lock()
+		delivered[slice]++
+		mu.Unlock()
+		return nil
+	})
+
+	if err := e.doSlices(context.Background(), handler); err != nil {
+		t.Fatalf("doSlices: %v", err)
+	}
+	if delivered[0] != 1 || delivered[1] != 1 {
+		t.Fatalf("got delivered=%v, want exactly one hit delivered per slice", delivered)
+	}
+	if got := atomic.LoadInt32(deletes); got != 2 {
+		t.Fatalf("got %d scroll_id deletes, want 2 (one per slice, regardless of how it stopped)", got)
+	}
+}
+
+func TestDoSlices_ReturnsRootCauseNotContextCanceled(t *testing.T) {
+	var deletes int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/idx/_doc/_search":
+			buf, _ := io.ReadAll(r.Body)
+			sliceID, serr := jsonparser.GetInt(buf, "slice", "id")
+			if serr != nil {
+				// estimateBatchSize's sampling request
+				_, _ = w.Write([]byte(`{"_shards":{"failed":0},"hits":{"total":1,"hits":[]}}`))
+				return
+			}
+			if sliceID == 0 {
+				// slice 0 fails for real right away; this is the root cause doSlices must
+				// surface, not whatever sibling slices see once this triggers cancellation
+				_, _ = w.Write([]byte(`{"_scroll_id":"scroll-fail","_shards":{"failed":1},"hits":{"total":1,"hits":[]}}`))
+				return
+			}
+			_, _ = w.Write([]byte(fmt.Sprintf(
+				`{"_scroll_id":"scroll-%d","_shards":{"failed":0},"hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_source":{"slice":%d}}]}}`,
+				sliceID, sliceID)))
+		case r.Method == http.MethodPost && r.URL.Path == "/_search/scroll":
+			// slice 1's continuation: stall until slice 0's failure cancels the shared
+			// context, then let the request fail with context.Canceled.
+			<-r.Context().Done()
+		case r.Method == http.MethodDelete && r.URL.Path == "/_search/scroll":
+			atomic.AddInt32(&deletes, 1)
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer ts.Close()
+
+	client, err := elastic.NewClient(elastic.SetURL(ts.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		t.Fatalf("elastic.NewClient: %v", err)
+	}
+
+	e := New(client, Options{Index: "idx", Slices: 2}, nil).(*exporter)
+	handler := ConcurrentSourceHandler(func(buf []byte, slice int, prg Progress) error { return nil })
+
+	err = e.doSlices(context.Background(), handler)
+	if err == nil {
+		t.Fatal("expected doSlices to return an error")
+	}
+	if !strings.Contains(err.Error(), "_shards.failed") {
+		t.Fatalf("got err %q, want the real root cause (_shards.failed != 0), not a masking context-canceled error", err.Error())
+	}
+}